@@ -7,41 +7,100 @@ package imagefactory
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
-	"github.com/blang/semver/v4"
 	"github.com/siderolabs/image-factory/pkg/client"
 	"github.com/siderolabs/image-factory/pkg/schematic"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
+// TalosVersionRecheckInterval is the default interval at which Client.Run refetches the available
+// Talos versions, matching the upstream image factory's own recheck interval.
+const TalosVersionRecheckInterval = 15 * time.Minute
+
+// factoryAPI is the subset of *client.Client the Client depends on, so that tests can substitute a
+// fake instead of requiring a live image factory.
+type factoryAPI interface {
+	Versions(ctx context.Context) ([]string, error)
+	SchematicCreate(ctx context.Context, sch schematic.Schematic) (string, error)
+}
+
 // Client is an image factory client.
 type Client struct {
-	factoryClient     *client.Client
+	factoryClient     factoryAPI
 	logger            *zap.Logger
 	pxeBaseURL        string
 	secureBootEnabled bool
+	versionRecheck    time.Duration
+	versions          atomic.Pointer[versionSnapshot]
+	refreshGroup      singleflight.Group
 }
 
-// NewClient creates a new image factory client.
-func NewClient(baseURL, pxeBaseURL string, secureBootEnabled bool, logger *zap.Logger) (*Client, error) {
+// NewClient creates a new image factory client. versionRecheckInterval configures how often Run
+// refetches the available Talos versions; zero defaults to TalosVersionRecheckInterval.
+func NewClient(baseURL, pxeBaseURL string, secureBootEnabled bool, versionRecheckInterval time.Duration, logger *zap.Logger) (*Client, error) {
 	factoryClient, err := client.New(baseURL)
 	if err != nil {
 		return nil, err
 	}
 
+	if versionRecheckInterval <= 0 {
+		versionRecheckInterval = TalosVersionRecheckInterval
+	}
+
 	return &Client{
 		pxeBaseURL:        pxeBaseURL,
 		factoryClient:     factoryClient,
 		secureBootEnabled: secureBootEnabled,
+		versionRecheck:    versionRecheckInterval,
 		logger:            logger,
 	}, nil
 }
 
+// Run periodically refetches the available Talos versions in the background until ctx is canceled,
+// so that GetLatestStableVersion and friends can be served from cache instead of making a live call
+// on every request.
+func (c *Client) Run(ctx context.Context) error {
+	if err := c.refreshVersions(ctx); err != nil {
+		c.logger.Warn("failed initial talos versions refresh", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(c.versionRecheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.refreshVersions(ctx); err != nil {
+				c.logger.Warn("failed to refresh talos versions", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Overlay describes an imager overlay to apply to a schematic, used to build board-specific images
+// for ARM SBCs (Raspberry Pi, Turing RK1, etc.) which need more than a stock kernel/U-Boot.
+type Overlay struct {
+	// Name is the overlay name, e.g. "rpi_generic", and also selects the iPXE URL board suffix.
+	Name string
+	// Image is the overlay installer image reference.
+	Image string
+	// Options carries arbitrary overlay-specific options.
+	Options map[string]any
+}
+
 // EnsureSchematic ensures a schematic exists on the image factory and returns its ID.
-func (c *Client) EnsureSchematic(ctx context.Context, extensions, extraKernelArgs []string) (string, error) {
+func (c *Client) EnsureSchematic(ctx context.Context, extensions, extraKernelArgs []string, overlay *Overlay) (string, error) {
 	logger := c.logger.With(zap.Strings("extensions", extensions), zap.Strings("extra_kernel_args", extraKernelArgs))
 
+	if overlay != nil {
+		logger = logger.With(zap.String("overlay", overlay.Name))
+	}
+
 	logger.Debug("ensure schematic")
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -56,6 +115,14 @@ func (c *Client) EnsureSchematic(ctx context.Context, extensions, extraKernelArg
 		},
 	}
 
+	if overlay != nil {
+		sch.Overlay = schematic.Overlay{
+			Name:    overlay.Name,
+			Image:   overlay.Image,
+			Options: overlay.Options,
+		}
+	}
+
 	marshaled, err := sch.Marshal()
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal schematic: %w", err)
@@ -71,8 +138,11 @@ func (c *Client) EnsureSchematic(ctx context.Context, extensions, extraKernelArg
 	return schematicID, nil
 }
 
-// GetIPXEURL returns the iPXE URL for the given schematic ID, Talos version, and architecture.
-func (c *Client) GetIPXEURL(schematicID, talosVersion, arch string) (string, error) {
+// GetIPXEURL returns the iPXE URL for the given schematic ID, Talos version, architecture, and
+// optional overlay name (e.g. "rpi_generic"), selecting a board-specific image for ARM SBCs.
+// secureBootOverride, if non-nil, overrides the client-wide secure-boot setting for this request
+// (e.g. a per-machine secure-boot toggle).
+func (c *Client) GetIPXEURL(schematicID, talosVersion, arch, overlayName string, secureBootOverride *bool) (string, error) {
 	if schematicID == "" {
 		return "", fmt.Errorf("schematic ID is required")
 	}
@@ -87,42 +157,34 @@ func (c *Client) GetIPXEURL(schematicID, talosVersion, arch string) (string, err
 
 	ipxeURL := fmt.Sprintf("%s/pxe/%s/%s/metal-%s", c.pxeBaseURL, schematicID, talosVersion, arch)
 
-	if c.secureBootEnabled {
+	if overlayName != "" {
+		ipxeURL += "-" + overlayName
+	}
+
+	secureBoot := c.secureBootEnabled
+	if secureBootOverride != nil {
+		secureBoot = *secureBootOverride
+	}
+
+	if secureBoot {
 		ipxeURL += "-secureboot"
 	}
 
 	return ipxeURL, nil
 }
 
-// GetLatestStableVersion returns the latest stable Talos version from the image factory.
+// GetLatestStableVersion returns the latest stable Talos version from the image factory, served from
+// the cache maintained by Run. On cold start (no background refresh has run yet) it falls back to a
+// synchronous fetch.
 func (c *Client) GetLatestStableVersion(ctx context.Context) (string, error) {
-	versions, err := c.factoryClient.Versions(ctx)
+	snapshot, err := c.versionSnapshot(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	var latestStable *semver.Version
-	for _, v := range versions {
-		sv, err := semver.ParseTolerant(v)
-		if err != nil {
-			c.logger.Warn("failed to parse version", zap.String("version", v), zap.Error(err))
-
-			continue
-		}
-
-		// Skip pre-releases
-		if len(sv.Pre) > 0 {
-			continue
-		}
-
-		if latestStable == nil || sv.GT(*latestStable) {
-			latestStable = &sv
-		}
-	}
-
-	if latestStable == nil {
+	if snapshot.latestStable == nil {
 		return "", fmt.Errorf("no stable versions found")
 	}
 
-	return latestStable.String(), nil
+	return snapshot.latestStable.String(), nil
 }
@@ -0,0 +1,134 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package imagefactory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blang/semver/v4"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// versionSnapshot is the result of the latest successful versions refresh.
+type versionSnapshot struct {
+	parsed       []semver.Version
+	latestStable *semver.Version
+}
+
+// versionSnapshot returns the cached version snapshot, falling back to a synchronous refresh if the
+// background refresher (Run) has not populated the cache yet. Concurrent cold-start callers are
+// coalesced into a single refreshVersions call, so that a burst of requests at process start doesn't
+// stampede the image factory.
+func (c *Client) versionSnapshot(ctx context.Context) (*versionSnapshot, error) {
+	if snapshot := c.versions.Load(); snapshot != nil {
+		return snapshot, nil
+	}
+
+	if _, err, _ := c.refreshGroup.Do("refresh", func() (any, error) {
+		return nil, c.refreshVersions(ctx)
+	}); err != nil {
+		return nil, err
+	}
+
+	return c.versions.Load(), nil
+}
+
+// refreshVersions fetches the available Talos versions from the image factory, parses them once,
+// and atomically swaps in the resulting snapshot.
+func (c *Client) refreshVersions(ctx context.Context) error {
+	rawVersions, err := c.factoryClient.Versions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch talos versions: %w", err)
+	}
+
+	parsed := make([]semver.Version, 0, len(rawVersions))
+
+	for _, v := range rawVersions {
+		sv, err := semver.ParseTolerant(v)
+		if err != nil {
+			c.logger.Warn("failed to parse version", zap.String("version", v), zap.Error(err))
+
+			continue
+		}
+
+		parsed = append(parsed, sv)
+	}
+
+	var latestStable *semver.Version
+
+	for i := range parsed {
+		if len(parsed[i].Pre) > 0 { // skip pre-releases
+			continue
+		}
+
+		if latestStable == nil || parsed[i].GT(*latestStable) {
+			latestStable = &parsed[i]
+		}
+	}
+
+	c.versions.Store(&versionSnapshot{parsed: parsed, latestStable: latestStable})
+
+	return nil
+}
+
+// GetLatestVersionInMajor returns the latest stable Talos version within the given major version,
+// so that callers can auto-track the newest release of a major without re-parsing every request.
+func (c *Client) GetLatestVersionInMajor(ctx context.Context, major int) (string, error) {
+	snapshot, err := c.versionSnapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var latest *semver.Version
+
+	for i := range snapshot.parsed {
+		sv := &snapshot.parsed[i]
+
+		if len(sv.Pre) > 0 || sv.Major != uint64(major) { //nolint:gosec
+			continue
+		}
+
+		if latest == nil || sv.GT(*latest) {
+			latest = sv
+		}
+	}
+
+	if latest == nil {
+		return "", fmt.Errorf("no stable version found for major %d", major)
+	}
+
+	return latest.String(), nil
+}
+
+// GetLatestPatch returns the latest stable Talos version within the given major.minor, so that
+// callers pinning to a Talos minor can auto-track patch releases without re-parsing every request.
+func (c *Client) GetLatestPatch(ctx context.Context, major, minor int) (string, error) {
+	snapshot, err := c.versionSnapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var latest *semver.Version
+
+	for i := range snapshot.parsed {
+		sv := &snapshot.parsed[i]
+
+		if len(sv.Pre) > 0 || sv.Major != uint64(major) || sv.Minor != uint64(minor) { //nolint:gosec
+			continue
+		}
+
+		if latest == nil || sv.GT(*latest) {
+			latest = sv
+		}
+	}
+
+	if latest == nil {
+		return "", fmt.Errorf("no stable patch version found for %d.%d", major, minor)
+	}
+
+	return latest.String(), nil
+}
@@ -0,0 +1,164 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package imagefactory
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/siderolabs/image-factory/pkg/schematic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeFactoryAPI is a factoryAPI that counts Versions calls and blocks until release is closed, so
+// tests can simulate many concurrent cold-start callers racing a single in-flight refresh.
+type fakeFactoryAPI struct {
+	calls   atomic.Int32
+	release chan struct{}
+	result  []string
+}
+
+func (f *fakeFactoryAPI) Versions(context.Context) ([]string, error) {
+	f.calls.Add(1)
+	<-f.release
+
+	return f.result, nil
+}
+
+func (f *fakeFactoryAPI) SchematicCreate(context.Context, schematic.Schematic) (string, error) {
+	return "", nil
+}
+
+// newTestClient returns a Client with its version cache pre-populated, so that the version lookup
+// methods can be exercised without a live image factory.
+func newTestClient(rawVersions ...string) *Client {
+	parsed := make([]semver.Version, 0, len(rawVersions))
+
+	for _, v := range rawVersions {
+		parsed = append(parsed, semver.MustParse(v))
+	}
+
+	var latestStable *semver.Version
+
+	for i := range parsed {
+		if len(parsed[i].Pre) > 0 {
+			continue
+		}
+
+		if latestStable == nil || parsed[i].GT(*latestStable) {
+			latestStable = &parsed[i]
+		}
+	}
+
+	c := &Client{}
+	c.versions.Store(&versionSnapshot{parsed: parsed, latestStable: latestStable})
+
+	return c
+}
+
+func TestGetLatestStableVersion(t *testing.T) {
+	c := newTestClient("1.8.0", "1.8.1", "1.9.0-beta.0")
+
+	got, err := c.GetLatestStableVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.8.1", got)
+}
+
+func TestGetLatestStableVersionNoneFound(t *testing.T) {
+	c := newTestClient("1.9.0-beta.0")
+
+	_, err := c.GetLatestStableVersion(context.Background())
+	assert.Error(t, err)
+}
+
+func TestGetLatestVersionInMajor(t *testing.T) {
+	c := newTestClient("1.8.0", "1.9.3", "1.9.2", "2.0.0")
+
+	got, err := c.GetLatestVersionInMajor(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "1.9.3", got)
+}
+
+func TestGetLatestVersionInMajorNoneFound(t *testing.T) {
+	c := newTestClient("1.8.0")
+
+	_, err := c.GetLatestVersionInMajor(context.Background(), 3)
+	assert.Error(t, err)
+}
+
+func TestGetLatestPatch(t *testing.T) {
+	c := newTestClient("1.8.0", "1.8.4", "1.8.3", "1.9.0")
+
+	got, err := c.GetLatestPatch(context.Background(), 1, 8)
+	require.NoError(t, err)
+	assert.Equal(t, "1.8.4", got)
+}
+
+func TestGetLatestPatchNoneFound(t *testing.T) {
+	c := newTestClient("1.8.0")
+
+	_, err := c.GetLatestPatch(context.Background(), 1, 9)
+	assert.Error(t, err)
+}
+
+// TestVersionSnapshotColdStartCoalescesConcurrentCallers verifies that concurrent cold-start callers
+// (before Run has populated the cache) share a single refreshVersions call via refreshGroup, instead
+// of each independently hitting the image factory.
+func TestVersionSnapshotColdStartCoalescesConcurrentCallers(t *testing.T) {
+	fake := &fakeFactoryAPI{release: make(chan struct{}), result: []string{"1.8.0", "1.8.1"}}
+
+	c := &Client{factoryClient: fake, logger: zap.NewNop()}
+
+	const callers = 20
+
+	var wg sync.WaitGroup
+
+	results := make([]string, callers)
+	errs := make([]error, callers)
+
+	for i := range callers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i], errs[i] = c.GetLatestStableVersion(context.Background())
+		}()
+	}
+
+	close(fake.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, fake.calls.Load())
+
+	for i := range callers {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "1.8.1", results[i])
+	}
+}
+
+// TestVersionSnapshotColdStartOnlyFetchesOnce verifies that once a cold-start refresh has populated
+// the cache, a subsequent call is served from it without fetching again.
+func TestVersionSnapshotColdStartOnlyFetchesOnce(t *testing.T) {
+	fake := &fakeFactoryAPI{release: make(chan struct{}), result: []string{"1.8.0"}}
+	close(fake.release)
+
+	c := &Client{factoryClient: fake, logger: zap.NewNop()}
+
+	first, err := c.GetLatestStableVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.8.0", first)
+
+	second, err := c.GetLatestStableVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.8.0", second)
+
+	assert.EqualValues(t, 1, fake.calls.Load())
+}
@@ -0,0 +1,52 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"context"
+	"net/http"
+)
+
+// DiskBootStrategy controls how the handler tells iPXE to boot from the local disk, for machines
+// which are already provisioned. Different firmware implementations cope differently with each
+// of these, so the strategy is configurable.
+type DiskBootStrategy string
+
+const (
+	// DiskBootNotFound replies with HTTP 404, so that iPXE falls through to the next boot device
+	// configured in the firmware's boot order.
+	DiskBootNotFound DiskBootStrategy = "not-found"
+	// DiskBootSanboot emits an iPXE script which sanboots the first local drive.
+	DiskBootSanboot DiskBootStrategy = "sanboot"
+	// DiskBootExit emits an iPXE script which exits the iPXE environment, handing control back to
+	// the firmware's boot order.
+	DiskBootExit DiskBootStrategy = "exit"
+)
+
+const (
+	sanbootScript = "#!ipxe\nsanboot --no-describe --drive 0x80\n"
+	exitScript    = "#!ipxe\nexit\n"
+)
+
+// MachineStateProvider is consulted on every boot request to decide whether a machine has already
+// been installed and should boot from its local disk instead of re-chainloading the Talos image.
+type MachineStateProvider interface {
+	// IsProvisioned reports whether the machine identified by uuid/mac has already been installed.
+	IsProvisioned(ctx context.Context, uuid, mac string) (bool, error)
+}
+
+// diskBootResponse returns the disk-boot response body and status code for the configured strategy.
+func (handler *Handler) diskBootResponse() (body string, statusCode int) {
+	switch handler.options.DiskBootStrategy {
+	case DiskBootSanboot:
+		return sanbootScript, http.StatusOK
+	case DiskBootExit:
+		return exitScript, http.StatusOK
+	case DiskBootNotFound:
+		fallthrough
+	default:
+		return "", http.StatusNotFound
+	}
+}
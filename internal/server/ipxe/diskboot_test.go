@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskBootResponse(t *testing.T) {
+	for _, tt := range []struct {
+		strategy   DiskBootStrategy
+		wantBody   string
+		wantStatus int
+	}{
+		{DiskBootSanboot, sanbootScript, http.StatusOK},
+		{DiskBootExit, exitScript, http.StatusOK},
+		{DiskBootNotFound, "", http.StatusNotFound},
+		{"", "", http.StatusNotFound},
+	} {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			handler := &Handler{options: HandlerOptions{DiskBootStrategy: tt.strategy}}
+
+			body, status := handler.diskBootResponse()
+			assert.Equal(t, tt.wantBody, body)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
+}
@@ -9,12 +9,18 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/siderolabs/talos/pkg/machinery/constants"
 	"go.uber.org/zap"
+
+	"github.com/siderolabs/booter/internal/server/imagefactory"
+	"github.com/siderolabs/booter/internal/server/siderolink"
+	"github.com/siderolabs/booter/internal/server/tftp"
 )
 
 const (
@@ -37,8 +43,8 @@ chain --replace %s
 
 // ImageFactoryClient represents an image factory client which ensures a schematic exists on image factory, and returns the PXE URL to it.
 type ImageFactoryClient interface {
-	EnsureSchematic(ctx context.Context, extensions, extraKernelArgs []string) (string, error)
-	GetIPXEURL(schematicID, talosVersion, arch string) (string, error)
+	EnsureSchematic(ctx context.Context, extensions, extraKernelArgs []string, overlay *imagefactory.Overlay) (string, error)
+	GetIPXEURL(schematicID, talosVersion, arch, overlayName string, secureBootOverride *bool) (string, error)
 }
 
 // HandlerOptions represents the options for the iPXE handler.
@@ -49,6 +55,51 @@ type HandlerOptions struct {
 	SchematicID         string
 	Extensions          []string
 	APIPort             int
+
+	// TFTPEnabled starts an embedded TFTP server alongside the HTTP handler, serving iPXE binaries
+	// which chainload into the HTTP iPXE boot script, so that machines which only speak legacy
+	// BIOS/PXE (DHCP options 66/67) can be booted without already running an iPXE-capable ROM.
+	TFTPEnabled bool
+	// TFTPListenAddress is the address the embedded TFTP server listens on, defaults to ":69".
+	TFTPListenAddress string
+
+	// MachineStateProvider, if set, is consulted on every boot request to decide whether the
+	// requesting machine has already been provisioned and should boot from its local disk instead
+	// of re-chainloading the Talos image.
+	MachineStateProvider MachineStateProvider
+	// DiskBootStrategy selects how already-provisioned machines are told to boot from disk, defaults
+	// to DiskBootNotFound.
+	DiskBootStrategy DiskBootStrategy
+
+	// MachineResolver, if set, resolves per-machine extensions, kernel args, Talos version and
+	// schematic ID overrides from the incoming request's uuid/mac/serial/hostname/arch.
+	MachineResolver MachineResolver
+
+	// SideroLinkAPIEndpoint, if set, is injected into every boot request's kernel args as
+	// siderolink.api=<host:port>, so that booting nodes join the SideroLink Wireguard overlay.
+	SideroLinkAPIEndpoint string
+	// SideroLinkGRPCListenAddress is the address the SideroLink provision gRPC service listens on,
+	// defaults to ":4000".
+	SideroLinkGRPCListenAddress string
+	// SideroLinkWireguardListenPort is the SideroLink Wireguard UDP listen port.
+	SideroLinkWireguardListenPort int
+	// SideroLinkJoinToken, if set, is required of every node provisioning over SideroLink. Since the
+	// provision gRPC listener has no other authentication, leave this unset only when it's reachable
+	// solely from a network already trusted at another layer.
+	SideroLinkJoinToken string
+
+	// Overlay, if set, selects an imager overlay (e.g. for ARM SBCs such as Raspberry Pi or Turing
+	// RK1) to apply to created schematics and to the served iPXE URL.
+	Overlay *imagefactory.Overlay
+
+	// InitLinkUpTimeout is how long the init script waits for link on each interface before moving
+	// on to the next one, defaults to 15 seconds.
+	InitLinkUpTimeout time.Duration
+	// InitDHCPRetries is how many times the init script retries DHCP on each interface before moving
+	// on to the next one, defaults to 3.
+	InitDHCPRetries int
+	// InitMaxInterfaces is how many network interfaces the init script iterates over, defaults to 4.
+	InitMaxInterfaces int
 }
 
 // Handler represents an iPXE handler.
@@ -58,6 +109,8 @@ type Handler struct {
 	kernelArgs         []string
 	initScript         []byte
 	options            HandlerOptions
+	schematicCache     *schematicCache
+	sideroLinkServer   *siderolink.Server
 }
 
 // ServeHTTP serves the iPXE request.
@@ -85,6 +138,8 @@ func (handler *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	uuid := query.Get("uuid")
 	mac := query.Get("mac")
 	arch := query.Get("arch")
+	serial := query.Get("serial")
+	hostname := query.Get("hostname")
 	logger := handler.logger.With(zap.String("uuid", uuid), zap.String("mac", mac), zap.String("arch", arch))
 
 	if arch != archArm64 { // https://ipxe.org/cfg/buildarch
@@ -93,14 +148,53 @@ func (handler *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	logger.Info("handle iPXE boot request")
 
-	// TODO: later, we can do per-machine kernel args and system extensions here
+	if handler.options.MachineStateProvider != nil {
+		provisioned, err := handler.options.MachineStateProvider.IsProvisioned(ctx, uuid, mac)
+		if err != nil {
+			logger.Error("failed to check machine state", zap.Error(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		if provisioned {
+			body, statusCode := handler.diskBootResponse()
+
+			logger.Info("machine already provisioned, booting from disk", zap.String("strategy", string(handler.options.DiskBootStrategy)))
+
+			w.WriteHeader(statusCode)
+
+			if _, err := w.Write([]byte(body)); err != nil {
+				logger.Error("failed to write disk boot response", zap.Error(err))
+			}
+
+			return
+		}
+	}
+
+	machineOptions, err := handler.resolveMachineOptions(ctx, MachineRequest{
+		UUID:     uuid,
+		MAC:      mac,
+		Serial:   serial,
+		Hostname: hostname,
+		Arch:     arch,
+	})
+	if err != nil {
+		logger.Error("failed to resolve per-machine options", zap.Error(err))
+
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
 
 	consoleKernelArgs := handler.consoleKernelArgs(arch)
-	kernelArgs := slices.Concat(handler.kernelArgs, consoleKernelArgs)
+	kernelArgs := slices.Concat(handler.kernelArgs, consoleKernelArgs, machineOptions.ExtraKernelArgs)
+	extensions := slices.Concat(handler.options.Extensions, machineOptions.Extensions)
 
 	logger.Debug("injected console kernel args to the iPXE request", zap.Strings("console_kernel_args", consoleKernelArgs))
 
-	body, statusCode, err := handler.bootViaFactoryIPXEScript(ctx, arch, kernelArgs)
+	body, statusCode, err := handler.bootViaFactoryIPXEScript(ctx, arch, kernelArgs, extensions, machineOptions)
 	if err != nil {
 		handler.logger.Error("failed to get iPXE script", zap.Error(err))
 
@@ -128,18 +222,41 @@ func (handler *Handler) handleInitScript(w http.ResponseWriter) {
 	}
 }
 
-func (handler *Handler) bootViaFactoryIPXEScript(ctx context.Context, arch string, kernelArgs []string) (body string, statusCode int, err error) {
+func (handler *Handler) bootViaFactoryIPXEScript(ctx context.Context, arch string, kernelArgs, extensions []string, machineOptions MachineOptions) (body string, statusCode int, err error) {
 	schematicID := handler.options.SchematicID
+	if machineOptions.SchematicID != "" {
+		schematicID = machineOptions.SchematicID
+	}
+
+	overlay := handler.options.Overlay
 
 	if schematicID == "" {
-		if schematicID, err = handler.imageFactoryClient.EnsureSchematic(ctx, handler.options.Extensions, kernelArgs); err != nil {
-			return "", http.StatusInternalServerError, fmt.Errorf("failed to get schematic IPXE URL: %w", err)
+		cacheKey := schematicCacheKey(extensions, kernelArgs, overlay)
+
+		var ok bool
+
+		if schematicID, ok = handler.schematicCache.get(cacheKey); !ok {
+			if schematicID, err = handler.imageFactoryClient.EnsureSchematic(ctx, extensions, kernelArgs, overlay); err != nil {
+				return "", http.StatusInternalServerError, fmt.Errorf("failed to get schematic IPXE URL: %w", err)
+			}
+
+			handler.schematicCache.set(cacheKey, schematicID)
 		}
 	}
 
+	talosVersion := handler.options.TalosVersion
+	if machineOptions.TalosVersion != "" {
+		talosVersion = machineOptions.TalosVersion
+	}
+
+	var overlayName string
+	if overlay != nil {
+		overlayName = overlay.Name
+	}
+
 	var ipxeURL string
 
-	if ipxeURL, err = handler.imageFactoryClient.GetIPXEURL(schematicID, handler.options.TalosVersion, arch); err != nil {
+	if ipxeURL, err = handler.imageFactoryClient.GetIPXEURL(schematicID, talosVersion, arch, overlayName, machineOptions.SecureBoot); err != nil {
 		return "", http.StatusInternalServerError, fmt.Errorf("failed to get schematic IPXE URL: %w", err)
 	}
 
@@ -148,6 +265,31 @@ func (handler *Handler) bootViaFactoryIPXEScript(ctx context.Context, arch strin
 	return ipxeScript, http.StatusOK, nil
 }
 
+// SideroLinkAddressFor returns the SideroLink tunnel address already allocated to nodeID, if
+// SideroLink is enabled and the node has provisioned, so that a MachineResolver or future config
+// server can address nodes over the overlay even when they sit behind NAT.
+func (handler *Handler) SideroLinkAddressFor(nodeID string) (netip.Addr, bool) {
+	if handler.sideroLinkServer == nil {
+		return netip.Addr{}, false
+	}
+
+	return handler.sideroLinkServer.AddressFor(nodeID)
+}
+
+// resolveMachineOptions resolves per-machine overrides via the configured MachineResolver, if any.
+func (handler *Handler) resolveMachineOptions(ctx context.Context, req MachineRequest) (MachineOptions, error) {
+	if handler.options.MachineResolver == nil {
+		return MachineOptions{}, nil
+	}
+
+	machineOptions, err := handler.options.MachineResolver.Resolve(ctx, req)
+	if err != nil {
+		return MachineOptions{}, fmt.Errorf("failed to resolve machine options: %w", err)
+	}
+
+	return machineOptions, nil
+}
+
 func (handler *Handler) consoleKernelArgs(arch string) []string {
 	switch arch {
 	case archArm64:
@@ -174,7 +316,7 @@ func NewHandler(ctx context.Context, configServerEnabled bool, imageFactoryClien
 		}
 	}
 
-	initScript, err := buildInitScript(options.APIAdvertiseAddress, options.APIPort)
+	initScript, err := buildInitScript(options.APIAdvertiseAddress, options.APIPort, options.InitLinkUpTimeout, options.InitDHCPRetries, options.InitMaxInterfaces)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build init script: %w", err)
 	}
@@ -187,6 +329,23 @@ func NewHandler(ctx context.Context, configServerEnabled bool, imageFactoryClien
 
 	logger.Info("successfully patched iPXE binaries")
 
+	if options.TFTPEnabled {
+		tftpServer, err := tftp.NewServer(tftp.Options{
+			ListenAddress:       options.TFTPListenAddress,
+			APIAdvertiseAddress: options.APIAdvertiseAddress,
+			APIPort:             options.APIPort,
+		}, logger.With(zap.String("component", "tftp")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tftp server: %w", err)
+		}
+
+		go func() {
+			if err := tftpServer.Run(ctx); err != nil {
+				logger.Error("tftp server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	kernelArgs := strings.Fields(options.ExtraKernelArgs)
 
 	if configServerEnabled {
@@ -195,11 +354,41 @@ func NewHandler(ctx context.Context, configServerEnabled bool, imageFactoryClien
 		logger.Debug("injected talos config kernel arg to the iPXE requests", zap.String("arg", talosConfigKernelArg))
 	}
 
+	var sideroLinkServer *siderolink.Server
+
+	if options.SideroLinkAPIEndpoint != "" {
+		if options.APIAdvertiseAddress == "" {
+			return nil, fmt.Errorf("siderolink requires APIAdvertiseAddress to be reachable")
+		}
+
+		sideroLinkKernelArg := fmt.Sprintf("siderolink.api=%s", options.SideroLinkAPIEndpoint)
+		kernelArgs = append(kernelArgs, sideroLinkKernelArg)
+
+		logger.Debug("injected siderolink kernel arg to the iPXE requests", zap.String("arg", sideroLinkKernelArg))
+
+		if sideroLinkServer, err = siderolink.NewServer(siderolink.Options{
+			APIAdvertiseAddress: options.APIAdvertiseAddress,
+			GRPCListenAddress:   options.SideroLinkGRPCListenAddress,
+			ListenPort:          options.SideroLinkWireguardListenPort,
+			JoinToken:           options.SideroLinkJoinToken,
+		}, logger.With(zap.String("component", "siderolink"))); err != nil {
+			return nil, fmt.Errorf("failed to create siderolink server: %w", err)
+		}
+
+		go func() {
+			if err := sideroLinkServer.Run(ctx); err != nil {
+				logger.Error("siderolink server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	return &Handler{
 		imageFactoryClient: imageFactoryClient,
 		options:            options,
 		kernelArgs:         kernelArgs,
 		initScript:         initScript,
 		logger:             logger,
+		schematicCache:     newSchematicCache(),
+		sideroLinkServer:   sideroLinkServer,
 	}, nil
 }
@@ -0,0 +1,101 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultInitLinkUpTimeout is how long buildInitScript waits for link on each interface before
+	// moving on to the next one.
+	defaultInitLinkUpTimeout = 15 * time.Second
+	// defaultInitDHCPRetries is how many times buildInitScript retries DHCP on each interface before
+	// moving on to the next one.
+	defaultInitDHCPRetries = 3
+	// defaultInitMaxInterfaces is how many network interfaces buildInitScript iterates over.
+	defaultInitMaxInterfaces = 4
+)
+
+// buildInitScript renders the iPXE init script served at initScriptName.
+//
+// The script iterates over every detected network interface, waits for link with a bounded
+// retry loop, retries DHCP a bounded number of times, and only then chains to the booter's HTTP
+// boot script. If every interface fails, it prints a diagnostic and drops into an iPXE shell
+// instead of hard-failing, so a machine whose switch port has not come up yet does not require a
+// manual reset once it does.
+func buildInitScript(apiAdvertiseAddress string, apiPort int, linkUpTimeout time.Duration, dhcpRetries, maxInterfaces int) ([]byte, error) {
+	if apiAdvertiseAddress == "" {
+		return nil, fmt.Errorf("apiAdvertiseAddress is required to build the init script")
+	}
+
+	if linkUpTimeout <= 0 {
+		linkUpTimeout = defaultInitLinkUpTimeout
+	}
+
+	if dhcpRetries <= 0 {
+		dhcpRetries = defaultInitDHCPRetries
+	}
+
+	if maxInterfaces <= 0 {
+		maxInterfaces = defaultInitMaxInterfaces
+	}
+
+	bootURL := fmt.Sprintf("http://%s/ipxe/%s", net.JoinHostPort(apiAdvertiseAddress, strconv.Itoa(apiPort)), bootScriptName)
+
+	var b strings.Builder
+
+	b.WriteString("#!ipxe\n\n")
+
+	for idx := range maxInterfaces {
+		writeInterfaceBootBlock(&b, idx, idx == maxInterfaces-1, linkUpTimeout, dhcpRetries)
+	}
+
+	fmt.Fprintf(&b, ":boot\necho booter: chaining to %s\nchain --replace %s\n\n", bootURL, bootURL)
+
+	b.WriteString(":all_failed\n")
+	b.WriteString("echo booter: no network interface came up, dropping to iPXE shell\n")
+	b.WriteString("shell\n")
+
+	return []byte(b.String()), nil
+}
+
+// writeInterfaceBootBlock writes the link-wait/DHCP-retry block for net<idx>, falling through to
+// net<idx+1> on failure, or to :all_failed if this is the last interface.
+func writeInterfaceBootBlock(b *strings.Builder, idx int, last bool, linkUpTimeout time.Duration, dhcpRetries int) {
+	iface := fmt.Sprintf("net%d", idx)
+	nextLabel := "all_failed"
+
+	if !last {
+		nextLabel = fmt.Sprintf("net%d_start", idx+1)
+	}
+
+	linkUpSeconds := int(linkUpTimeout.Seconds())
+
+	fmt.Fprintf(b, ":%s_start\n", iface)
+	fmt.Fprintf(b, "isset ${%s/mac} || goto %s\n", iface, nextLabel)
+	fmt.Fprintf(b, "ifopen %s\n", iface)
+	fmt.Fprintf(b, "set %s-linkwait:int32 0\n", iface)
+	fmt.Fprintf(b, ":%s_link_wait\n", iface)
+	fmt.Fprintf(b, "iseq ${%s/link} up && goto %s_dhcp ||\n", iface, iface)
+	fmt.Fprintf(b, "iseq ${%s-linkwait} %d && goto %s_failed ||\n", iface, linkUpSeconds, iface)
+	fmt.Fprintf(b, "inc %s-linkwait\n", iface)
+	b.WriteString("sleep 1\n")
+	fmt.Fprintf(b, "goto %s_link_wait\n", iface)
+	fmt.Fprintf(b, ":%s_dhcp\n", iface)
+	fmt.Fprintf(b, "set %s-dhcpwait:int32 0\n", iface)
+	fmt.Fprintf(b, ":%s_dhcp_retry\n", iface)
+	fmt.Fprintf(b, "dhcp %s && goto boot ||\n", iface)
+	fmt.Fprintf(b, "iseq ${%s-dhcpwait} %d && goto %s_failed ||\n", iface, dhcpRetries, iface)
+	fmt.Fprintf(b, "inc %s-dhcpwait\n", iface)
+	fmt.Fprintf(b, "goto %s_dhcp_retry\n", iface)
+	fmt.Fprintf(b, ":%s_failed\n", iface)
+	fmt.Fprintf(b, "echo booter: %s did not come up, trying next interface\n", iface)
+	fmt.Fprintf(b, "goto %s\n\n", nextLabel)
+}
@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInitScript(t *testing.T) {
+	script, err := buildInitScript("10.0.0.1", 8080, 5*time.Second, 2, 2)
+	require.NoError(t, err)
+
+	s := string(script)
+
+	assert.True(t, strings.HasPrefix(s, "#!ipxe\n"))
+	assert.Contains(t, s, "chain --replace http://10.0.0.1:8080/ipxe/boot.ipxe\n")
+	assert.Contains(t, s, ":net0_start\n")
+	assert.Contains(t, s, ":net1_start\n")
+	assert.Contains(t, s, "goto net1_start\n")
+	assert.Contains(t, s, ":all_failed\n")
+	assert.Contains(t, s, "shell\n")
+}
+
+func TestBuildInitScriptRequiresAdvertiseAddress(t *testing.T) {
+	_, err := buildInitScript("", 8080, 0, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestBuildInitScriptDefaults(t *testing.T) {
+	script, err := buildInitScript("10.0.0.1", 8080, 0, 0, 0)
+	require.NoError(t, err)
+
+	s := string(script)
+
+	for idx := range defaultInitMaxInterfaces {
+		assert.Contains(t, s, ":net"+strconv.Itoa(idx)+"_start\n")
+	}
+}
+
+func TestWriteInterfaceBootBlockFallsThroughToNextInterface(t *testing.T) {
+	var b strings.Builder
+
+	writeInterfaceBootBlock(&b, 0, false, 5*time.Second, 3)
+
+	s := b.String()
+
+	assert.Contains(t, s, ":net0_start\n")
+	assert.Contains(t, s, "goto net1_start\n")
+	assert.Contains(t, s, "iseq ${net0-linkwait} 5 && goto net0_failed ||\n")
+	assert.Contains(t, s, "iseq ${net0-dhcpwait} 3 && goto net0_failed ||\n")
+}
+
+func TestWriteInterfaceBootBlockLastFallsThroughToAllFailed(t *testing.T) {
+	var b strings.Builder
+
+	writeInterfaceBootBlock(&b, 1, true, 5*time.Second, 3)
+
+	assert.Contains(t, b.String(), "goto all_failed\n")
+}
@@ -0,0 +1,140 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MachineRequest describes the boot request of a single machine, as parsed from the iPXE query string.
+type MachineRequest struct {
+	UUID     string
+	MAC      string
+	Serial   string
+	Hostname string
+	Arch     string
+}
+
+// MachineOptions is a per-machine set of overrides resolved by a MachineResolver. Zero values mean
+// "use the handler-wide default" for every field except Extensions/ExtraKernelArgs, which are
+// additive to the handler-wide defaults.
+type MachineOptions struct {
+	Extensions      []string `yaml:"extensions,omitempty"`
+	ExtraKernelArgs []string `yaml:"extraKernelArgs,omitempty"`
+	TalosVersion    string   `yaml:"talosVersion,omitempty"`
+	SchematicID     string   `yaml:"schematicID,omitempty"`
+	// SecureBoot, if non-nil, overrides the image factory client's default secure-boot setting for
+	// this machine.
+	SecureBoot *bool `yaml:"secureBoot,omitempty"`
+}
+
+// MachineResolver resolves per-machine boot options from the incoming iPXE request identity.
+type MachineResolver interface {
+	Resolve(ctx context.Context, req MachineRequest) (MachineOptions, error)
+}
+
+// StaticResolver is an in-memory MachineResolver serving fleet-wide defaults with optional
+// per-node overrides keyed by UUID or MAC.
+type StaticResolver struct {
+	defaults  MachineOptions
+	overrides map[string]MachineOptions
+}
+
+// NewStaticResolver creates a StaticResolver with the given fleet-wide defaults and no overrides.
+func NewStaticResolver(defaults MachineOptions) *StaticResolver {
+	return &StaticResolver{
+		defaults:  defaults,
+		overrides: map[string]MachineOptions{},
+	}
+}
+
+// SetOverride registers a per-node override, keyed by the node's UUID or MAC address.
+func (r *StaticResolver) SetOverride(uuidOrMAC string, options MachineOptions) {
+	r.overrides[uuidOrMAC] = options
+}
+
+// Resolve implements MachineResolver.
+func (r *StaticResolver) Resolve(_ context.Context, req MachineRequest) (MachineOptions, error) {
+	if override, ok := r.overrides[req.UUID]; ok && req.UUID != "" {
+		return override, nil
+	}
+
+	if override, ok := r.overrides[req.MAC]; ok && req.MAC != "" {
+		return override, nil
+	}
+
+	return r.defaults, nil
+}
+
+// fileResolverConfig is the on-disk representation loaded by FileResolver.
+type fileResolverConfig struct {
+	Defaults  MachineOptions            `yaml:"defaults"`
+	Overrides map[string]MachineOptions `yaml:"overrides"`
+}
+
+// FileResolver is a MachineResolver backed by a YAML file on disk, re-read on every Resolve call so
+// that operators can update fleet-wide defaults and per-node overrides without restarting booter.
+type FileResolver struct {
+	path string
+
+	mu     sync.Mutex
+	config fileResolverConfig
+}
+
+// NewFileResolver creates a FileResolver reading its configuration from path.
+func NewFileResolver(path string) (*FileResolver, error) {
+	r := &FileResolver{path: path}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Resolve implements MachineResolver.
+func (r *FileResolver) Resolve(_ context.Context, req MachineRequest) (MachineOptions, error) {
+	if err := r.reload(); err != nil {
+		return MachineOptions{}, fmt.Errorf("failed to reload machine resolver config: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if override, ok := r.config.Overrides[req.UUID]; ok && req.UUID != "" {
+		return override, nil
+	}
+
+	if override, ok := r.config.Overrides[req.MAC]; ok && req.MAC != "" {
+		return override, nil
+	}
+
+	return r.config.Defaults, nil
+}
+
+func (r *FileResolver) reload() error {
+	contents, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read machine resolver config %q: %w", r.path, err)
+	}
+
+	var config fileResolverConfig
+
+	if err = yaml.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("failed to parse machine resolver config %q: %w", r.path, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.config = config
+
+	return nil
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/booter/internal/server/ipxe"
+)
+
+func TestStaticResolver(t *testing.T) {
+	defaults := ipxe.MachineOptions{TalosVersion: "v1.8.0"}
+	resolver := ipxe.NewStaticResolver(defaults)
+
+	resolver.SetOverride("uuid-1", ipxe.MachineOptions{TalosVersion: "v1.9.0"})
+	resolver.SetOverride("aa:bb:cc:dd:ee:ff", ipxe.MachineOptions{TalosVersion: "v1.9.1"})
+
+	for _, tt := range []struct {
+		name string
+		req  ipxe.MachineRequest
+		want string
+	}{
+		{"no match falls back to defaults", ipxe.MachineRequest{UUID: "unknown"}, "v1.8.0"},
+		{"uuid override takes precedence", ipxe.MachineRequest{UUID: "uuid-1"}, "v1.9.0"},
+		{"mac override used when uuid does not match", ipxe.MachineRequest{UUID: "unknown", MAC: "aa:bb:cc:dd:ee:ff"}, "v1.9.1"},
+		{"uuid override wins over mac override", ipxe.MachineRequest{UUID: "uuid-1", MAC: "aa:bb:cc:dd:ee:ff"}, "v1.9.0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.TalosVersion)
+		})
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolver.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+defaults:
+  talosVersion: v1.8.0
+overrides:
+  uuid-1:
+    talosVersion: v1.9.0
+    secureBoot: true
+`), 0o644))
+
+	resolver, err := ipxe.NewFileResolver(path)
+	require.NoError(t, err)
+
+	options, err := resolver.Resolve(context.Background(), ipxe.MachineRequest{UUID: "uuid-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "v1.9.0", options.TalosVersion)
+	require.NotNil(t, options.SecureBoot)
+	assert.True(t, *options.SecureBoot)
+
+	defaultOptions, err := resolver.Resolve(context.Background(), ipxe.MachineRequest{UUID: "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, "v1.8.0", defaultOptions.TalosVersion)
+	assert.Nil(t, defaultOptions.SecureBoot)
+
+	// editing the file on disk is picked up on the next Resolve call, without recreating the resolver.
+	require.NoError(t, os.WriteFile(path, []byte(`
+defaults:
+  talosVersion: v1.10.0
+`), 0o644))
+
+	updatedOptions, err := resolver.Resolve(context.Background(), ipxe.MachineRequest{UUID: "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, "v1.10.0", updatedOptions.TalosVersion)
+}
@@ -0,0 +1,84 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/siderolabs/booter/internal/server/imagefactory"
+)
+
+// schematicCache memoizes schematic IDs already created on the image factory, keyed by a content
+// hash of the inputs that produced them, so that repeated boots of the same machine (or of
+// machines sharing identical extensions/kernel args) do not create a new schematic on every boot.
+type schematicCache struct {
+	mu    sync.Mutex
+	byKey map[string]string
+}
+
+func newSchematicCache() *schematicCache {
+	return &schematicCache{
+		byKey: map[string]string{},
+	}
+}
+
+func (c *schematicCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, ok := c.byKey[key]
+
+	return id, ok
+}
+
+func (c *schematicCache) set(key, schematicID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byKey[key] = schematicID
+}
+
+// schematicCacheKey computes a stable content hash over the schematic inputs.
+func schematicCacheKey(extensions, extraKernelArgs []string, overlay *imagefactory.Overlay) string {
+	extensions = slices.Clone(extensions)
+	extraKernelArgs = slices.Clone(extraKernelArgs)
+
+	slices.Sort(extensions)
+	slices.Sort(extraKernelArgs)
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "extensions=%s;kernelArgs=%s", strings.Join(extensions, ","), strings.Join(extraKernelArgs, ","))
+
+	if overlay != nil {
+		fmt.Fprintf(h, ";overlay=%s;overlayImage=%s;overlayOptions=%s", overlay.Name, overlay.Image, overlayOptionsKey(overlay.Options))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// overlayOptionsKey serializes overlay options into a stable, order-independent string, so that two
+// machines sharing an overlay name/image but differing options (e.g. board variant knobs) don't
+// collide on the same cache key.
+func overlayOptionsKey(options map[string]any) string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, options[k]))
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,56 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ipxe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/siderolabs/booter/internal/server/imagefactory"
+)
+
+func TestSchematicCacheKey(t *testing.T) {
+	base := schematicCacheKey([]string{"ext-a", "ext-b"}, []string{"arg-a"}, &imagefactory.Overlay{
+		Name:  "rpi_generic",
+		Image: "some/image",
+		Options: map[string]any{
+			"board": "rpi4",
+			"tty":   "ttyS0",
+		},
+	})
+
+	t.Run("stable regardless of slice and map order", func(t *testing.T) {
+		reordered := schematicCacheKey([]string{"ext-b", "ext-a"}, []string{"arg-a"}, &imagefactory.Overlay{
+			Name:  "rpi_generic",
+			Image: "some/image",
+			Options: map[string]any{
+				"tty":   "ttyS0",
+				"board": "rpi4",
+			},
+		})
+
+		assert.Equal(t, base, reordered)
+	})
+
+	t.Run("differing overlay options produce a different key", func(t *testing.T) {
+		differentOptions := schematicCacheKey([]string{"ext-a", "ext-b"}, []string{"arg-a"}, &imagefactory.Overlay{
+			Name:  "rpi_generic",
+			Image: "some/image",
+			Options: map[string]any{
+				"board": "rk1",
+				"tty":   "ttyS0",
+			},
+		})
+
+		assert.NotEqual(t, base, differentOptions)
+	})
+
+	t.Run("nil overlay produces a different key than any overlay", func(t *testing.T) {
+		noOverlay := schematicCacheKey([]string{"ext-a", "ext-b"}, []string{"arg-a"}, nil)
+
+		assert.NotEqual(t, base, noOverlay)
+	})
+}
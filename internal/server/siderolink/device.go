@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package siderolink
+
+import (
+	"fmt"
+	"net"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/ipc"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// createUserspaceDevice creates a userspace Wireguard TUN interface named interfaceName and starts
+// its UAPI listener, so that wgctrl.ConfigureDevice (which auto-detects userspace implementations
+// via their UAPI socket) can subsequently configure it like any kernel Wireguard interface. The
+// returned listener must be closed by the caller to stop the accept loop and remove the UAPI socket.
+func createUserspaceDevice(interfaceName string, logger *zap.Logger) (*device.Device, net.Listener, error) {
+	tunDevice, err := tun.CreateTUN(interfaceName, device.DefaultMTU)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create tun device %q: %w", interfaceName, err)
+	}
+
+	wgDevice := device.NewDevice(tunDevice, conn.NewDefaultBind(), &device.Logger{
+		Verbosef: logger.Sugar().Debugf,
+		Errorf:   logger.Sugar().Errorf,
+	})
+
+	uapi, err := ipc.UAPIListen(interfaceName)
+	if err != nil {
+		wgDevice.Close()
+
+		return nil, nil, fmt.Errorf("failed to listen on uapi socket for %q: %w", interfaceName, err)
+	}
+
+	go func() {
+		for {
+			uapiConn, err := uapi.Accept()
+			if err != nil {
+				return
+			}
+
+			go wgDevice.IpcHandle(uapiConn)
+		}
+	}()
+
+	if err := wgDevice.Up(); err != nil {
+		uapi.Close() //nolint:errcheck
+		wgDevice.Close()
+
+		return nil, nil, fmt.Errorf("failed to bring up wireguard device %q: %w", interfaceName, err)
+	}
+
+	return wgDevice, uapi, nil
+}
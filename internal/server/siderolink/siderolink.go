@@ -0,0 +1,308 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package siderolink runs a minimal SideroLink server: it listens for gRPC provision requests from
+// booting Talos nodes, allocates them an IPv6 ULA tunnel address, and configures a userspace
+// Wireguard peer for each, so that nodes remain addressable over the overlay even when they sit
+// behind NAT.
+package siderolink
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/siderolabs/siderolink/api/siderolink"
+)
+
+// joinTokenMetadataKey is the gRPC metadata key a provisioning node must set to Options.JoinToken.
+const joinTokenMetadataKey = "siderolink-join-token"
+
+// DefaultPrefix is the IPv6 ULA prefix SideroLink allocates node tunnel addresses from.
+const DefaultPrefix = "fdae:41e4:649b:9303::/64"
+
+// defaultInterfaceName is the name of the userspace Wireguard device SideroLink configures peers on.
+const defaultInterfaceName = "siderolink"
+
+// defaultGRPCListenAddress is where the SideroLink provision gRPC service listens by default.
+const defaultGRPCListenAddress = ":4000"
+
+// Options represents the options for the SideroLink server.
+type Options struct {
+	// APIAdvertiseAddress is the address booter is reachable on; SideroLink refuses to start without it.
+	APIAdvertiseAddress string
+	// GRPCListenAddress is the address the provision gRPC service listens on, defaults to ":4000".
+	GRPCListenAddress string
+	// ListenPort is the Wireguard UDP listen port.
+	ListenPort int
+	// InterfaceName is the Wireguard device name, defaults to "siderolink".
+	InterfaceName string
+	// Prefix is the IPv6 ULA prefix tunnel addresses are allocated from, defaults to DefaultPrefix.
+	Prefix string
+	// JoinToken, if set, is required as the "siderolink-join-token" gRPC metadata value of every
+	// Provision request. Since the gRPC listener is otherwise unauthenticated, any host that can
+	// reach it could join the overlay and be handed a Wireguard peer slot; leave unset only on a
+	// network already trusted/isolated at another layer (e.g. a private provisioning VLAN).
+	JoinToken string
+}
+
+// Peer describes a provisioned SideroLink node.
+type Peer struct {
+	Address   netip.Addr
+	PublicKey wgtypes.Key
+}
+
+// wireguardClient is the subset of *wgctrl.Client the Server depends on, so that tests can substitute
+// a fake instead of requiring a real Wireguard device.
+type wireguardClient interface {
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+	Close() error
+}
+
+// Server is a minimal SideroLink server. It allocates IPv6 ULA tunnel addresses to provisioning
+// nodes and configures them as Wireguard peers, exposing their addresses to the rest of booter (e.g.
+// a MachineResolver) so nodes can be addressed over the overlay.
+type Server struct {
+	pb.UnimplementedProvisionServiceServer
+
+	logger     *zap.Logger
+	options    Options
+	prefix     netip.Prefix
+	device     *device.Device
+	uapi       net.Listener
+	wgClient   wireguardClient
+	privateKey wgtypes.Key
+
+	mu           sync.Mutex
+	nextHostPart uint64
+	peers        map[string]Peer
+}
+
+// NewServer creates a new SideroLink server: it generates a server Wireguard keypair, brings up a
+// userspace Wireguard interface, and prepares it to accept peers. It refuses to start if no
+// advertise address is reachable, since provisioned nodes would otherwise have no server to dial.
+func NewServer(options Options, logger *zap.Logger) (*Server, error) {
+	if options.APIAdvertiseAddress == "" {
+		return nil, fmt.Errorf("siderolink requires a reachable advertise address")
+	}
+
+	prefixStr := options.Prefix
+	if prefixStr == "" {
+		prefixStr = DefaultPrefix
+	}
+
+	prefix, err := netip.ParsePrefix(prefixStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid siderolink prefix %q: %w", prefixStr, err)
+	}
+
+	interfaceName := options.InterfaceName
+	if interfaceName == "" {
+		interfaceName = defaultInterfaceName
+	}
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate wireguard private key: %w", err)
+	}
+
+	wgDevice, uapi, err := createUserspaceDevice(interfaceName, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wireguard device: %w", err)
+	}
+
+	wgClient, err := wgctrl.New()
+	if err != nil {
+		uapi.Close() //nolint:errcheck
+		wgDevice.Close()
+
+		return nil, fmt.Errorf("failed to open wireguard control client: %w", err)
+	}
+
+	if err = wgClient.ConfigureDevice(interfaceName, wgtypes.Config{
+		PrivateKey: &privateKey,
+		ListenPort: &options.ListenPort,
+	}); err != nil {
+		wgClient.Close() //nolint:errcheck
+		uapi.Close()     //nolint:errcheck
+		wgDevice.Close()
+
+		return nil, fmt.Errorf("failed to configure wireguard device %q: %w", interfaceName, err)
+	}
+
+	return &Server{
+		logger:       logger,
+		options:      options,
+		prefix:       prefix,
+		device:       wgDevice,
+		uapi:         uapi,
+		wgClient:     wgClient,
+		privateKey:   privateKey,
+		nextHostPart: 1,
+		peers:        map[string]Peer{},
+	}, nil
+}
+
+// Run starts the provision gRPC service and blocks until ctx is canceled or the server fails.
+func (s *Server) Run(ctx context.Context) error {
+	listenAddress := s.options.GRPCListenAddress
+	if listenAddress == "" {
+		listenAddress = defaultGRPCListenAddress
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %w", listenAddress, err)
+	}
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(s.authInterceptor))
+	pb.RegisterProvisionServiceServer(grpcServer, s)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- grpcServer.Serve(listener)
+	}()
+
+	s.logger.Info("siderolink provision service listening", zap.String("address", listenAddress))
+
+	select {
+	case <-ctx.Done():
+		grpcServer.GracefulStop()
+		s.close()
+
+		return nil
+	case err := <-errCh:
+		s.close()
+
+		return fmt.Errorf("siderolink grpc server failed: %w", err)
+	}
+}
+
+func (s *Server) close() {
+	s.wgClient.Close() //nolint:errcheck
+	s.uapi.Close()     //nolint:errcheck
+	s.device.Close()
+}
+
+// authInterceptor rejects requests whose "siderolink-join-token" metadata does not match
+// Options.JoinToken. If no JoinToken is configured, every request is allowed through: the gRPC
+// listener is otherwise unauthenticated, so operators relying on this mode are trusting the network
+// it's reachable from (e.g. a private provisioning VLAN) instead.
+func (s *Server) authInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.options.JoinToken == "" {
+		return handler(ctx, req)
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(joinTokenMetadataKey)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "missing siderolink join token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(md.Get(joinTokenMetadataKey)[0]), []byte(s.options.JoinToken)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "invalid siderolink join token")
+	}
+
+	return handler(ctx, req)
+}
+
+// Provision implements pb.ProvisionServiceServer: it allocates a tunnel address for the requesting
+// node (or returns its existing one) and configures it as a Wireguard peer. Callers are
+// authenticated by authInterceptor against Options.JoinToken, not by this method.
+func (s *Server) Provision(ctx context.Context, req *pb.ProvisionRequest) (*pb.ProvisionResponse, error) {
+	publicKey, err := wgtypes.ParseKey(req.GetNodePublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("invalid node public key: %w", err)
+	}
+
+	address, err := s.provision(req.GetNodeUuid(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ProvisionResponse{
+		ServerEndpoint:    s.options.APIAdvertiseAddress,
+		ServerPublicKey:   s.privateKey.PublicKey().String(),
+		NodeAddressPrefix: fmt.Sprintf("%s/%d", address, s.prefix.Bits()),
+	}, nil
+}
+
+// provision allocates a tunnel address for nodeID and configures it as a Wireguard peer, returning
+// its assigned address. Calling provision again for an already-known nodeID returns the address
+// already allocated to it instead of allocating a new one.
+func (s *Server) provision(nodeID string, publicKey wgtypes.Key) (netip.Addr, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if peer, ok := s.peers[nodeID]; ok {
+		return peer.Address, nil
+	}
+
+	address := s.allocateLocked()
+
+	if err := s.configurePeer(address, publicKey); err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to configure wireguard peer for %q: %w", nodeID, err)
+	}
+
+	s.peers[nodeID] = Peer{Address: address, PublicKey: publicKey}
+
+	s.logger.Info("provisioned siderolink peer", zap.String("node", nodeID), zap.Stringer("address", address))
+
+	return address, nil
+}
+
+// AddressFor returns the tunnel address already allocated to nodeID, if any.
+func (s *Server) AddressFor(nodeID string) (netip.Addr, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	peer, ok := s.peers[nodeID]
+
+	return peer.Address, ok
+}
+
+// allocateLocked returns the next unused address in the SideroLink prefix. Callers must hold s.mu.
+func (s *Server) allocateLocked() netip.Addr {
+	base := s.prefix.Addr().As16()
+
+	var hostPart [8]byte
+
+	binary.BigEndian.PutUint64(hostPart[:], s.nextHostPart)
+	s.nextHostPart++
+
+	copy(base[8:], hostPart[:])
+
+	return netip.AddrFrom16(base)
+}
+
+// configurePeer adds or updates the Wireguard peer for address/publicKey on the SideroLink device.
+func (s *Server) configurePeer(address netip.Addr, publicKey wgtypes.Key) error {
+	interfaceName := s.options.InterfaceName
+	if interfaceName == "" {
+		interfaceName = defaultInterfaceName
+	}
+
+	allowedIPs := []net.IPNet{{IP: address.AsSlice(), Mask: net.CIDRMask(128, 128)}}
+
+	return s.wgClient.ConfigureDevice(interfaceName, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:         publicKey,
+			AllowedIPs:        allowedIPs,
+			ReplaceAllowedIPs: true,
+		}},
+	})
+}
@@ -0,0 +1,153 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package siderolink
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWireguardClient is a wireguardClient that records ConfigureDevice calls instead of touching a
+// real Wireguard device, so Server's peer-allocation logic can be tested without a TUN interface.
+type fakeWireguardClient struct {
+	configureCalls int
+}
+
+func (f *fakeWireguardClient) ConfigureDevice(string, wgtypes.Config) error {
+	f.configureCalls++
+
+	return nil
+}
+
+func (f *fakeWireguardClient) Close() error { return nil }
+
+func newTestServer(t *testing.T) (*Server, *fakeWireguardClient) {
+	prefix, err := netip.ParsePrefix(DefaultPrefix)
+	require.NoError(t, err)
+
+	wgClient := &fakeWireguardClient{}
+
+	return &Server{
+		logger:       zap.NewNop(),
+		options:      Options{APIAdvertiseAddress: "10.0.0.1:4000"},
+		prefix:       prefix,
+		wgClient:     wgClient,
+		nextHostPart: 1,
+		peers:        map[string]Peer{},
+	}, wgClient
+}
+
+func TestServerAllocateLocked(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	first := s.allocateLocked()
+	second := s.allocateLocked()
+
+	assert.True(t, s.prefix.Contains(first))
+	assert.True(t, s.prefix.Contains(second))
+	assert.NotEqual(t, first, second)
+}
+
+func TestServerProvision(t *testing.T) {
+	s, wgClient := newTestServer(t)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	address, err := s.provision("node-1", key.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, s.prefix.Contains(address))
+	assert.Equal(t, 1, wgClient.configureCalls)
+
+	resolved, ok := s.AddressFor("node-1")
+	require.True(t, ok)
+	assert.Equal(t, address, resolved)
+}
+
+func TestServerProvisionIsIdempotent(t *testing.T) {
+	s, wgClient := newTestServer(t)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	first, err := s.provision("node-1", key.PublicKey())
+	require.NoError(t, err)
+
+	second, err := s.provision("node-1", key.PublicKey())
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, wgClient.configureCalls)
+}
+
+func TestServerProvisionAllocatesDistinctAddressesPerNode(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	key1, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	key2, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	address1, err := s.provision("node-1", key1.PublicKey())
+	require.NoError(t, err)
+
+	address2, err := s.provision("node-2", key2.PublicKey())
+	require.NoError(t, err)
+
+	assert.NotEqual(t, address1, address2)
+}
+
+func TestServerAddressForUnknownNode(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	_, ok := s.AddressFor("unknown")
+	assert.False(t, ok)
+}
+
+func echoHandler(_ context.Context, req any) (any, error) { return req, nil }
+
+func TestAuthInterceptorNoTokenConfigured(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	_, err := s.authInterceptor(context.Background(), "req", nil, echoHandler)
+	assert.NoError(t, err)
+}
+
+func TestAuthInterceptorMissingToken(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.options.JoinToken = "secret"
+
+	_, err := s.authInterceptor(context.Background(), "req", nil, echoHandler)
+	assert.Error(t, err)
+}
+
+func TestAuthInterceptorWrongToken(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.options.JoinToken = "secret"
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(joinTokenMetadataKey, "wrong"))
+
+	_, err := s.authInterceptor(ctx, "req", nil, echoHandler)
+	assert.Error(t, err)
+}
+
+func TestAuthInterceptorCorrectToken(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.options.JoinToken = "secret"
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(joinTokenMetadataKey, "secret"))
+
+	resp, err := s.authInterceptor(ctx, "req", nil, echoHandler)
+	require.NoError(t, err)
+	assert.Equal(t, "req", resp)
+}
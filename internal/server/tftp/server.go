@@ -0,0 +1,174 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package tftp implements an embedded TFTP server which serves architecture-specific
+// iPXE binaries to machines which PXE boot via DHCP options 66/67, without requiring
+// the machine to already speak iPXE (e.g. legacy BIOS or UEFI HTTP boot ROMs).
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	tftplib "github.com/pin/tftp/v3"
+	"go.uber.org/zap"
+)
+
+// Filenames served over TFTP, addressable via DHCP option 67 (bootfile-name).
+const (
+	// FilenameIPXE is the amd64 UEFI iPXE binary.
+	FilenameIPXE = "ipxe.efi"
+	// FilenameIPXESNP is the amd64 UEFI iPXE binary built against the UEFI SNP driver, for NICs without their own UEFI driver.
+	FilenameIPXESNP = "snp.efi"
+	// FilenameIPXEARM64 is the arm64 UEFI iPXE binary.
+	FilenameIPXEARM64 = "ipxe-arm64.efi"
+	// FilenameUndionly is the legacy BIOS iPXE binary.
+	FilenameUndionly = "undionly.kpxe"
+)
+
+//go:embed assets/ipxe.efi assets/snp.efi assets/ipxe-arm64.efi assets/undionly.kpxe
+var assetsFS embed.FS
+
+// defaultListenAddress is the default TFTP listen address, port 69 is the well-known TFTP port.
+const defaultListenAddress = ":69"
+
+// Options represents the options for the TFTP server.
+type Options struct {
+	// ListenAddress is the address the TFTP server listens on, defaults to ":69".
+	ListenAddress string
+	// APIAdvertiseAddress is the address of the booter HTTP server that the served binaries should chainload to.
+	APIAdvertiseAddress string
+	// APIPort is the port of the booter HTTP server.
+	APIPort int
+}
+
+// Server is an embedded TFTP server serving iPXE binaries pre-patched with a chainload script
+// pointing at the booter HTTP iPXE handler.
+type Server struct {
+	logger        *zap.Logger
+	files         map[string][]byte
+	listenAddress string
+}
+
+// NewServer creates a new TFTP server, patching the embedded iPXE binaries with a chainload script.
+func NewServer(options Options, logger *zap.Logger) (*Server, error) {
+	if options.APIAdvertiseAddress == "" {
+		return nil, fmt.Errorf("APIAdvertiseAddress is required for the TFTP server")
+	}
+
+	script := buildChainloadScript(options.APIAdvertiseAddress, options.APIPort)
+
+	assetPaths := map[string]string{
+		FilenameIPXE:      "assets/ipxe.efi",
+		FilenameIPXESNP:   "assets/snp.efi",
+		FilenameIPXEARM64: "assets/ipxe-arm64.efi",
+		FilenameUndionly:  "assets/undionly.kpxe",
+	}
+
+	files := make(map[string][]byte, len(assetPaths))
+
+	for filename, assetPath := range assetPaths {
+		raw, err := assetsFS.ReadFile(assetPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded iPXE binary %q: %w", filename, err)
+		}
+
+		patched, err := embedScript(raw, script)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chainload script into %q: %w", filename, err)
+		}
+
+		files[filename] = patched
+	}
+
+	listenAddress := options.ListenAddress
+	if listenAddress == "" {
+		listenAddress = defaultListenAddress
+	}
+
+	return &Server{
+		logger:        logger,
+		files:         files,
+		listenAddress: listenAddress,
+	}, nil
+}
+
+// Run starts the TFTP server and blocks until ctx is canceled or the server fails.
+func (s *Server) Run(ctx context.Context) error {
+	srv := tftplib.NewServer(s.readHandler, nil)
+	srv.SetTimeout(5 * time.Second)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- srv.ListenAndServe(s.listenAddress)
+	}()
+
+	s.logger.Info("tftp server listening", zap.String("address", s.listenAddress))
+
+	select {
+	case <-ctx.Done():
+		srv.Shutdown()
+
+		return nil
+	case err := <-errCh:
+		return fmt.Errorf("tftp server failed: %w", err)
+	}
+}
+
+func (s *Server) readHandler(filename string, rf io.ReaderFrom) error {
+	filename = strings.TrimPrefix(filename, "/")
+
+	data, ok := s.files[filename]
+	if !ok {
+		return fmt.Errorf("unknown file %q", filename)
+	}
+
+	if raddr, ok := rf.(interface{ RemoteAddr() net.Addr }); ok {
+		s.logger.Debug("tftp read request", zap.String("filename", filename), zap.Stringer("remote", raddr.RemoteAddr()))
+	}
+
+	_, err := rf.ReadFrom(bytes.NewReader(data))
+
+	return err
+}
+
+// scriptPlaceholder is a reserved, zero-padded region baked into the embedded iPXE binaries at build
+// time, which embedScript overwrites with the actual chainload script, the same way patchBinaries
+// patches the init script placeholder of the HTTP-served ROMs.
+const scriptPlaceholder = "\x00#!ipxe-embedded-script-placeholder#######################################################\x00"
+
+// buildChainloadScript returns the embedded iPXE script that immediately chainloads the booter's
+// HTTP iPXE boot script, so a single DHCP/TFTP hop reaches booter's HTTP endpoint.
+func buildChainloadScript(apiAdvertiseAddress string, apiPort int) []byte {
+	apiHostPort := net.JoinHostPort(apiAdvertiseAddress, strconv.Itoa(apiPort))
+
+	return fmt.Appendf(nil, "#!ipxe\nchain --replace http://%s/ipxe/boot.ipxe\n", apiHostPort)
+}
+
+// embedScript patches a copy of binary, replacing the reserved scriptPlaceholder region with script.
+func embedScript(binary, script []byte) ([]byte, error) {
+	idx := bytes.Index(binary, []byte(scriptPlaceholder))
+	if idx == -1 {
+		return nil, fmt.Errorf("embedded script placeholder not found in binary")
+	}
+
+	if len(script) > len(scriptPlaceholder) {
+		return nil, fmt.Errorf("chainload script (%d bytes) exceeds reserved placeholder size (%d bytes)", len(script), len(scriptPlaceholder))
+	}
+
+	patched := bytes.Clone(binary)
+
+	clear(patched[idx : idx+len(scriptPlaceholder)])
+	copy(patched[idx:], script)
+
+	return patched, nil
+}
@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tftp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildChainloadScript(t *testing.T) {
+	script := buildChainloadScript("10.0.0.1", 8080)
+
+	assert.True(t, strings.HasPrefix(string(script), "#!ipxe\n"))
+	assert.Contains(t, string(script), "chain --replace http://10.0.0.1:8080/ipxe/boot.ipxe\n")
+}
+
+func TestEmbedScript(t *testing.T) {
+	binary := append([]byte("prefix-bytes"), []byte(scriptPlaceholder)...)
+	binary = append(binary, []byte("suffix-bytes")...)
+
+	script := []byte("#!ipxe\nchain --replace http://example.com/ipxe/boot.ipxe\n")
+
+	patched, err := embedScript(binary, script)
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(patched, []byte("prefix-bytes")))
+	assert.True(t, bytes.HasSuffix(patched, []byte("suffix-bytes")))
+	assert.Contains(t, string(patched), string(script))
+	assert.NotContains(t, string(patched), scriptPlaceholder)
+
+	// the original binary is left untouched.
+	assert.Contains(t, string(binary), scriptPlaceholder)
+}
+
+func TestEmbedScriptPlaceholderNotFound(t *testing.T) {
+	_, err := embedScript([]byte("no placeholder here"), []byte("#!ipxe\n"))
+	assert.Error(t, err)
+}
+
+func TestEmbedScriptTooLarge(t *testing.T) {
+	binary := append([]byte("prefix-"), []byte(scriptPlaceholder)...)
+
+	oversized := bytes.Repeat([]byte("x"), len(scriptPlaceholder)+1)
+
+	_, err := embedScript(binary, oversized)
+	assert.Error(t, err)
+}